@@ -1,18 +1,32 @@
 package consumer
 
 import (
+	"bufio"
 	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
 	"gollum/shared"
+	"math"
 	"math/rand"
+	"os"
 	"sync"
 	"time"
 )
 
 type Profiler struct {
 	standardConsumer
-	profileRuns int
-	batches     int
-	length      int
+	profileRuns  int
+	batches      int
+	length       int
+	source       string
+	sourceFile   string
+	pcapFile     string
+	pcapRealtime bool
+	zipfS        float64
+	zipfV        float64
+	enqueued     chan time.Time
+	histogram    *latencyHistogram
 }
 
 func init() {
@@ -26,32 +40,330 @@ func (cons Profiler) Create(conf shared.PluginConfig, pool *shared.BytePool) (sh
 	cons.batches = conf.GetInt("Batches", 10)
 	cons.length = conf.GetInt("Length", 256)
 
+	cons.source = conf.GetString("Source", "string")
+	cons.sourceFile = conf.GetString("File", "")
+	cons.pcapFile = conf.GetString("PcapFile", "")
+	cons.pcapRealtime = conf.GetBool("PcapRealtime", true)
+	cons.zipfS = conf.GetFloat64("ZipfS", 1.1)
+	cons.zipfV = conf.GetFloat64("ZipfV", 1.0)
+
+	cons.enqueued = make(chan time.Time, cons.profileRuns)
+	cons.histogram = newLatencyHistogram()
+
 	return cons, err
 }
 
 var stringBase = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ01234567890 _.!?/&%$§'")
 
-func (cons Profiler) profile() {
+// payloadSource produces the next message body to profile with. Runs and
+// Batches set how many messages are sent for every source; Length sets the
+// payload size of the "string" source and the upper bound of the "zipf"
+// source's message length, and is ignored by "file" and "pcap".
+type payloadSource interface {
+	next() string
+}
+
+// newSource builds the payloadSource selected by the Source config value,
+// falling back to the synthetic "string" generator (this consumer's
+// original and still default behavior) if a more specific source fails to
+// initialize.
+func (cons Profiler) newSource() payloadSource {
+	switch cons.source {
+	case "file":
+		src, err := newFileSource(cons.sourceFile)
+		if err != nil {
+			shared.Log.Error(fmt.Sprintf("Profiler: failed to open source file %s: %s", cons.sourceFile, err))
+			break
+		}
+		return src
 
-	randString := make([]rune, cons.length)
-	for i := 0; i < cons.length; i++ {
-		randString[i] = stringBase[rand.Intn(len(stringBase))]
+	case "pcap":
+		src, err := newPcapSource(cons.pcapFile, cons.pcapRealtime)
+		if err != nil {
+			shared.Log.Error(fmt.Sprintf("Profiler: failed to open pcap file %s: %s", cons.pcapFile, err))
+			break
+		}
+		return src
+
+	case "zipf":
+		return newZipfSource(cons.zipfS, cons.zipfV, cons.length)
 	}
 
-	var msg string
-	for b := 0; b < cons.batches; b++ {
+	return newStringSource(cons.length)
+}
+
+// stringSource is the original synthetic payload generator: a single
+// random string of Length characters, repeated for every message.
+type stringSource struct {
+	payload string
+}
+
+func newStringSource(length int) *stringSource {
+	runes := make([]rune, length)
+	for i := range runes {
+		runes[i] = stringBase[rand.Intn(len(stringBase))]
+	}
+	return &stringSource{payload: string(runes)}
+}
+
+func (s *stringSource) next() string {
+	return s.payload
+}
+
+// fileSource replays a captured log file line by line, looping back to the
+// start once every line has been sent.
+type fileSource struct {
+	lines []string
+	index int
+}
+
+func newFileSource(path string) (*fileSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	src := &fileSource{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		src.lines = append(src.lines, scanner.Text())
+	}
+	return src, scanner.Err()
+}
 
+func (s *fileSource) next() string {
+	if len(s.lines) == 0 {
+		return ""
+	}
+	line := s.lines[s.index%len(s.lines)]
+	s.index++
+	return line
+}
+
+// pcapSource replays the UDP payloads captured in a pcap file, either at
+// their original inter-packet spacing (PcapRealtime) or as fast as
+// possible.
+type pcapSource struct {
+	payloads []string
+	gaps     []time.Duration
+	realtime bool
+	index    int
+}
+
+func newPcapSource(path string, realtime bool) (*pcapSource, error) {
+	handle, err := pcap.OpenOffline(path)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+
+	src := &pcapSource{realtime: realtime}
+	var lastTimestamp time.Time
+
+	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
+	for packet := range packetSource.Packets() {
+		udpLayer := packet.Layer(layers.LayerTypeUDP)
+		if udpLayer == nil {
+			continue
+		}
+		udp := udpLayer.(*layers.UDP)
+
+		timestamp := packet.Metadata().Timestamp
+		gap := time.Duration(0)
+		if !lastTimestamp.IsZero() {
+			gap = timestamp.Sub(lastTimestamp)
+		}
+		lastTimestamp = timestamp
+
+		src.payloads = append(src.payloads, string(udp.Payload))
+		src.gaps = append(src.gaps, gap)
+	}
+
+	if len(src.payloads) == 0 {
+		return nil, fmt.Errorf("no UDP packets found in %s", path)
+	}
+	return src, nil
+}
+
+func (s *pcapSource) next() string {
+	if s.realtime && s.gaps[s.index] > 0 {
+		time.Sleep(s.gaps[s.index])
+	}
+	payload := s.payloads[s.index]
+	s.index = (s.index + 1) % len(s.payloads)
+	return payload
+}
+
+// zipfSource generates messages whose length follows a Zipf distribution,
+// simulating the skewed message-size mix a production log stream tends to
+// have instead of the uniform length of the "string" source.
+type zipfSource struct {
+	zipf *rand.Zipf
+}
+
+func newZipfSource(s, v float64, maxLength int) *zipfSource {
+	if maxLength < 1 {
+		maxLength = 1
+	}
+	return &zipfSource{
+		zipf: rand.NewZipf(rand.New(rand.NewSource(time.Now().UnixNano())), s, v, uint64(maxLength)),
+	}
+}
+
+func (z *zipfSource) next() string {
+	length := int(z.zipf.Uint64()) + 1
+	runes := make([]rune, length)
+	for i := range runes {
+		runes[i] = stringBase[rand.Intn(len(stringBase))]
+	}
+	return string(runes)
+}
+
+// latencyHistogram is an HDR-style log-linear histogram covering 1µs to
+// 60s, used to track the time between a message being enqueued and it
+// being acknowledged as consumed downstream (see Profiler.Ack). record is
+// called from Ack, which runs on whatever goroutine downstream completion
+// notifications arrive on, while reset and percentile are called from
+// profile, so counts/total are guarded by guard rather than assumed
+// single-threaded.
+type latencyHistogram struct {
+	guard  sync.Mutex
+	counts []int64
+	total  int64
+}
+
+const (
+	histogramMinValue         = time.Microsecond
+	histogramMaxValue         = 60 * time.Second
+	histogramBucketsPerDecade = 100
+)
+
+func newLatencyHistogram() *latencyHistogram {
+	decades := math.Log10(float64(histogramMaxValue) / float64(histogramMinValue))
+	buckets := int(decades*histogramBucketsPerDecade) + 1
+	return &latencyHistogram{counts: make([]int64, buckets+1)}
+}
+
+func (h *latencyHistogram) bucketFor(d time.Duration) int {
+	switch {
+	case d <= histogramMinValue:
+		return 0
+	case d >= histogramMaxValue:
+		return len(h.counts) - 1
+	default:
+		decades := math.Log10(float64(d) / float64(histogramMinValue))
+		return int(decades * histogramBucketsPerDecade)
+	}
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	h.guard.Lock()
+	defer h.guard.Unlock()
+	h.counts[h.bucketFor(d)]++
+	h.total++
+}
+
+func (h *latencyHistogram) reset() {
+	h.guard.Lock()
+	defer h.guard.Unlock()
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.total = 0
+}
+
+// valueForBucket returns the upper bound latency represented by bucket i.
+func (h *latencyHistogram) valueForBucket(i int) time.Duration {
+	return time.Duration(float64(histogramMinValue) * math.Pow(10, float64(i+1)/histogramBucketsPerDecade))
+}
+
+// percentile returns the latency below which the given fraction (0-1) of
+// recorded samples fall.
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	h.guard.Lock()
+	defer h.guard.Unlock()
+
+	if h.total == 0 {
+		return 0
+	}
+	target := int64(p * float64(h.total))
+	var cumulative int64
+	for i, count := range h.counts {
+		cumulative += count
+		if cumulative >= target {
+			return h.valueForBucket(i)
+		}
+	}
+	return histogramMaxValue
+}
+
+// Ack is called once a profiled message has been fully processed
+// downstream (e.g. by a completion-aware producer wrapped around the
+// pipeline under test). It matches messages in FIFO order, which holds as
+// long as they are consumed in the order they were produced, and feeds the
+// enqueue-to-completion latency into the current batch's histogram. This
+// lets the profiler measure producer backpressure, not just raw enqueue
+// throughput.
+func (cons Profiler) Ack() {
+	select {
+	case enqueuedAt := <-cons.enqueued:
+		cons.histogram.record(time.Since(enqueuedAt))
+	default:
+		// Nothing pending; an Ack without a matching postMessage is ignored.
+	}
+}
+
+func (cons Profiler) profile() {
+	source := cons.newSource()
+
+	for b := 0; b < cons.batches; b++ {
+		drainEnqueued(cons.enqueued) // discard stragglers drainCompletions gave up on, they belong to the last batch, not this one
+		cons.histogram.reset()
 		start := time.Now()
+
 		for i := 0; i < cons.profileRuns; i++ {
-			msg = fmt.Sprintf("%d/%d %s", i, cons.profileRuns, string(randString))
-			cons.postMessage(msg)
+			payload := source.next()
+			cons.enqueued <- time.Now()
+			cons.postMessage(payload)
 		}
+
+		cons.drainCompletions(cons.profileRuns)
 		runTime := time.Since(start)
 
 		shared.Log.Note(fmt.Sprintf(
-			"Profile run #%d: %.4f sec = %4.f msg/sec",
-			b, runTime.Seconds(),
-			float64(cons.profileRuns)/runTime.Seconds()))
+			"Profile run #%d: %.4f sec = %4.f msg/sec, p50=%s p90=%s p99=%s p99.9=%s",
+			b, runTime.Seconds(), float64(cons.profileRuns)/runTime.Seconds(),
+			cons.histogram.percentile(0.50), cons.histogram.percentile(0.90),
+			cons.histogram.percentile(0.99), cons.histogram.percentile(0.999)))
+	}
+}
+
+// drainEnqueued discards every timestamp currently buffered in ch without
+// blocking, so a batch's send loop never blocks writing into a channel
+// still holding entries drainCompletions timed out waiting on.
+func drainEnqueued(ch chan time.Time) {
+	for {
+		select {
+		case <-ch:
+		default:
+			return
+		}
+	}
+}
+
+// drainCompletions gives downstream Ack calls a short grace period to
+// catch up at the end of a batch, so the histogram printed for this batch
+// reflects as many completions as realistically possible.
+func (cons Profiler) drainCompletions(expected int) {
+	grace := time.After(5 * time.Second)
+	for i := 0; i < expected; i++ {
+		select {
+		case enqueuedAt := <-cons.enqueued:
+			cons.histogram.record(time.Since(enqueuedAt))
+		case <-grace:
+			return // ### return, downstream did not ack the remaining messages in time ###
+		}
 	}
 }
 
@@ -66,4 +378,4 @@ func (cons Profiler) Consume(threads *sync.WaitGroup) {
 			return // ### return ###
 		}
 	}
-}
\ No newline at end of file
+}
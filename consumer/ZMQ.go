@@ -0,0 +1,268 @@
+// Copyright 2015-2016 trivago GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-zeromq/zmq4"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/log"
+	"github.com/trivago/gollum/shared"
+	"io/ioutil"
+	"sync"
+)
+
+// ZMQ consumer plugin
+// This consumer reads messages from a ZeroMQ socket. It is built on a
+// CGo-free ZMTP implementation so it does not require libzmq to be
+// installed, and is intended as gollum's transport for fan-out between
+// gollum instances (e.g. across data centers) without routing through
+// Kafka or a raw TCP socket.
+// When attached to a fuse, this consumer disconnects its socket in case
+// that fuse is burned and reconnects once the fuse becomes active again,
+// mirroring consumer.Syslogd.
+// Configuration example
+//
+//  - "consumer.ZMQ":
+//    Address: "tcp://*:5880"
+//    SocketType: "Sub"
+//    SubscribeTopics:
+//      - "auth."
+//
+// Address defines the endpoint to bind (Sub, Pull, Router) or connect
+// (Dealer) to. By default this is set to "tcp://*:5880".
+//
+// SocketType selects the ZeroMQ socket pattern to use. By default this is
+// set to "Sub".
+//  * Sub (paired with producer.ZMQ's Pub)
+//  * Pull (paired with producer.ZMQ's Push)
+//  * Router (paired with producer.ZMQ's Dealer)
+//  * Dealer (connects to a remote Router; producer.ZMQ does not offer one)
+//
+// SubscribeTopics is a list of topic prefixes this consumer subscribes to
+// when SocketType is "Sub". An empty list (the default) subscribes to
+// every topic.
+//
+// HighWaterMark sets the number of messages to queue in memory before the
+// socket starts blocking or dropping messages, depending on the socket
+// type. By default this is set to 1000.
+//
+// Linger sets the number of milliseconds a socket keeps trying to deliver
+// pending messages after Close is called. By default this is set to 0.
+//
+// CurveSecretKeyFile and CurvePublicKeyFile point to files holding this
+// socket's CURVE Z85 keypair. CurveServerKeyFile additionally points to
+// the remote server's public key when connecting as a CURVE client. When
+// unset (the default) CURVE authentication is disabled.
+type ZMQ struct {
+	core.ConsumerBase
+	address         string   `config:"required" key:"Address"`
+	socketType      string   `config:"enum=Sub|Pull|Router|Dealer" key:"SocketType"`
+	subscribeTopics []string
+	highWaterMark   int
+	linger          int
+	curve           curveConfig
+	sequence        *uint64
+
+	socketGuard sync.Mutex
+	socket      zmq4.Socket
+	cancel      context.CancelFunc
+}
+
+// curveConfig bundles the CURVE keypair/server key file paths shared by
+// consumer.ZMQ and producer.ZMQ.
+type curveConfig struct {
+	secretKeyFile string
+	publicKeyFile string
+	serverKeyFile string
+}
+
+func init() {
+	shared.TypeRegistry.Register(ZMQ{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *ZMQ) Configure(conf core.PluginConfig) error {
+	err := cons.ConsumerBase.Configure(conf)
+	if err != nil {
+		return err
+	}
+
+	cons.address = conf.GetString("Address", "tcp://*:5880")
+	cons.socketType = conf.GetString("SocketType", "Sub")
+	cons.subscribeTopics = conf.GetStringArray("SubscribeTopics", []string{})
+	cons.highWaterMark = conf.GetInt("HighWaterMark", 1000)
+	cons.linger = conf.GetInt("Linger", 0)
+
+	cons.curve = curveConfig{
+		secretKeyFile: conf.GetString("CurveSecretKeyFile", ""),
+		publicKeyFile: conf.GetString("CurvePublicKeyFile", ""),
+		serverKeyFile: conf.GetString("CurveServerKeyFile", ""),
+	}
+
+	switch cons.socketType {
+	case "Sub", "Pull", "Router", "Dealer":
+	default:
+		return fmt.Errorf("ZMQ: unknown socket type %s", cons.socketType) // ### return, unknown socket type ###
+	}
+
+	cons.sequence = new(uint64)
+	return nil
+}
+
+// Consume binds the configured ZeroMQ socket and starts receiving
+// messages.
+func (cons *ZMQ) Consume(workers *sync.WaitGroup) {
+	cons.open()
+	cons.SetFuseBurnedCallback(cons.close)
+	cons.SetFuseActiveCallback(cons.open)
+	cons.ControlLoop()
+}
+
+func (cons *ZMQ) open() {
+	ctx, cancel := context.WithCancel(context.Background())
+	options := curveOptions(cons.curve)
+
+	var socket zmq4.Socket
+	switch cons.socketType {
+	case "Sub":
+		socket = zmq4.NewSub(ctx, options...)
+	case "Pull":
+		socket = zmq4.NewPull(ctx, options...)
+	case "Router":
+		socket = zmq4.NewRouter(ctx, options...)
+	case "Dealer":
+		socket = zmq4.NewDealer(ctx, options...)
+	}
+
+	applySocketTuning(socket, cons.highWaterMark, cons.linger)
+
+	if cons.socketType == "Sub" {
+		topics := cons.subscribeTopics
+		if len(topics) == 0 {
+			topics = []string{""}
+		}
+		for _, topic := range topics {
+			if err := socket.SetOption(zmq4.OptionSubscribe, topic); err != nil {
+				Log.Warning.Print("ZMQ: Failed to subscribe to topic ", topic, ": ", err)
+			}
+		}
+	}
+
+	// Dealer is the connecting side of a Router/Dealer pairing (the remote
+	// Router binds; producer.ZMQ does not offer Router); every other socket
+	// type here binds and waits for producer.ZMQ to connect.
+	var err error
+	if cons.socketType == "Dealer" {
+		err = socket.Dial(cons.address)
+	} else {
+		err = socket.Listen(cons.address)
+	}
+	if err != nil {
+		Log.Error.Print("ZMQ: Failed to reach ", cons.address, ": ", err)
+		cancel()
+		return
+	}
+
+	cons.socketGuard.Lock()
+	cons.socket = socket
+	cons.cancel = cancel
+	cons.socketGuard.Unlock()
+
+	go cons.read(socket)
+}
+
+func (cons *ZMQ) close() {
+	cons.socketGuard.Lock()
+	defer cons.socketGuard.Unlock()
+
+	if cons.socket != nil {
+		cons.socket.Close()
+		cons.socket = nil
+	}
+	if cons.cancel != nil {
+		cons.cancel()
+		cons.cancel = nil
+	}
+}
+
+func (cons *ZMQ) read(socket zmq4.Socket) {
+	for {
+		msg, err := socket.Recv()
+		if err != nil {
+			return // ### return, socket closed ###
+		}
+
+		sequence := *cons.sequence
+		*cons.sequence++
+
+		if !cons.setMetadata() {
+			cons.Enqueue(msg.Bytes(), sequence)
+			continue
+		}
+
+		meta := core.Metadata{}
+		if len(msg.Frames) > 1 {
+			meta.SetValue("zmq_identity", msg.Frames[0])
+		}
+		cons.EnqueueWithMetadata(msg.Bytes(), meta, sequence)
+	}
+}
+
+// setMetadata reports whether identity frames (Router sockets) should be
+// attached as metadata. Router is the only socket type that carries one.
+func (cons *ZMQ) setMetadata() bool {
+	return cons.socketType == "Router"
+}
+
+// curveOptions builds the zmq4 dialer/listener options implementing CURVE
+// authentication from a set of Z85 keypair files, if configured.
+func curveOptions(curve curveConfig) []zmq4.Option {
+	if curve.secretKeyFile == "" || curve.publicKeyFile == "" {
+		return nil
+	}
+
+	secret, err := ioutil.ReadFile(curve.secretKeyFile)
+	if err != nil {
+		Log.Error.Print("ZMQ: Failed to read CurveSecretKeyFile: ", err)
+		return nil
+	}
+	public, err := ioutil.ReadFile(curve.publicKeyFile)
+	if err != nil {
+		Log.Error.Print("ZMQ: Failed to read CurvePublicKeyFile: ", err)
+		return nil
+	}
+
+	options := []zmq4.Option{zmq4.WithSecurity(zmq4.NewCurveSecurity(string(public), string(secret)))}
+
+	if curve.serverKeyFile != "" {
+		serverKey, err := ioutil.ReadFile(curve.serverKeyFile)
+		if err != nil {
+			Log.Error.Print("ZMQ: Failed to read CurveServerKeyFile: ", err)
+			return options
+		}
+		options = append(options, zmq4.WithServerPublicKey(string(serverKey)))
+	}
+
+	return options
+}
+
+// applySocketTuning sets the high-water-mark and linger socket options,
+// ignoring errors from backends that do not support tuning a given option.
+func applySocketTuning(socket zmq4.Socket, highWaterMark, lingerMillis int) {
+	socket.SetOption(zmq4.OptionHWM, highWaterMark)
+	socket.SetOption(zmq4.OptionLinger, lingerMillis)
+}
@@ -0,0 +1,246 @@
+// Copyright 2015-2016 trivago GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux
+
+package consumer
+
+import (
+	"fmt"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/log"
+	"github.com/trivago/gollum/shared"
+	"github.com/trivago/gollum/shared/syslog"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// SyslogUnixgram consumer plugin
+// This consumer binds a SOCK_DGRAM unix socket at a well-known path (by
+// default /dev/log) and acts as a local syslogd, i.e. a drop-in sink for
+// processes that log via syslog(3). Unlike consumer.Syslogd's "unix"
+// protocol, the socket permissions are widened to let unprivileged
+// processes connect and the sending process' credentials are captured via
+// SO_PASSCRED.
+// Configuration example
+//
+//  - "consumer.SyslogUnixgram":
+//    Address: "/dev/log"
+//    Permissions: 0666
+//
+// Address defines the path of the socket to create. By default this is set
+// to "/dev/log".
+//
+// Permissions sets the file mode applied to the socket after creation so
+// that unprivileged processes can write to it. By default this is set to
+// 0666.
+//
+// UseCurrentYear, StrictHostname, SetMetadata, MetadataFields,
+// SeverityFilter and FacilityFilter behave exactly as in consumer.Syslogd.
+// In addition, when SetMetadata is enabled, the PID/UID/GID of the process
+// that sent the message (as reported by SO_PASSCRED) are attached under the
+// "peer_pid", "peer_uid" and "peer_gid" metadata keys for auditability.
+type SyslogUnixgram struct {
+	core.ConsumerBase
+	path           string
+	permissions    os.FileMode
+	parser         *syslog.Parser
+	sequence       *uint64
+	setMetadata    bool
+	metadataFields map[string]string
+	severityFilter map[int]bool
+	facilityFilter map[int]bool
+
+	socketGuard sync.Mutex
+	conn        *net.UnixConn
+}
+
+func init() {
+	shared.TypeRegistry.Register(SyslogUnixgram{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *SyslogUnixgram) Configure(conf core.PluginConfig) error {
+	err := cons.ConsumerBase.Configure(conf)
+	if err != nil {
+		return err
+	}
+
+	cons.path = conf.GetString("Address", "/dev/log")
+	cons.permissions = os.FileMode(conf.GetInt("Permissions", 0666))
+
+	cons.sequence = new(uint64)
+	cons.parser = syslog.NewParser(syslog.Options{
+		UseCurrentYear: conf.GetBool("UseCurrentYear", true),
+		StrictHostname: conf.GetBool("StrictHostname", false),
+	})
+
+	cons.setMetadata = conf.GetBool("SetMetadata", false)
+	cons.metadataFields = defaultMetadataFields()
+	for field, name := range conf.GetStringMap("MetadataFields", map[string]string{}) {
+		cons.metadataFields[field] = name
+	}
+
+	cons.severityFilter = toFilterSet(conf.GetIntArray("SeverityFilter", []int64{}))
+	cons.facilityFilter = toFilterSet(conf.GetIntArray("FacilityFilter", []int64{}))
+
+	return nil
+}
+
+// Consume binds the devlog socket and starts decoding datagrams.
+func (cons *SyslogUnixgram) Consume(workers *sync.WaitGroup) {
+	cons.open()
+	cons.SetFuseBurnedCallback(cons.close)
+	cons.SetFuseActiveCallback(cons.open)
+	cons.ControlLoop()
+}
+
+func (cons *SyslogUnixgram) open() {
+	os.Remove(cons.path) // ### remove, a stale socket from a previous run ###
+
+	addr, err := net.ResolveUnixAddr("unixgram", cons.path)
+	if err != nil {
+		Log.Error.Print("SyslogUnixgram: Failed to resolve ", cons.path)
+		return
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		Log.Error.Print("SyslogUnixgram: Failed to open ", cons.path)
+		return
+	}
+
+	if err := os.Chmod(cons.path, cons.permissions); err != nil {
+		Log.Error.Print("SyslogUnixgram: Failed to set permissions on ", cons.path)
+	}
+
+	if err := enablePassCred(conn); err != nil {
+		Log.Warning.Print("SyslogUnixgram: SO_PASSCRED not available, peer credentials will be missing: ", err)
+	}
+
+	cons.socketGuard.Lock()
+	cons.conn = conn
+	cons.socketGuard.Unlock()
+
+	go cons.read(conn)
+}
+
+func (cons *SyslogUnixgram) close() {
+	cons.socketGuard.Lock()
+	defer cons.socketGuard.Unlock()
+
+	if cons.conn != nil {
+		cons.conn.Close()
+		cons.conn = nil
+	}
+	os.Remove(cons.path)
+}
+
+// enablePassCred turns on SO_PASSCRED on the socket underlying conn so that
+// every subsequent datagram carries an SCM_CREDENTIALS ancillary message
+// with the sender's PID/UID/GID.
+func enablePassCred(conn *net.UnixConn) error {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockoptErr error
+	err = rawConn.Control(func(fd uintptr) {
+		sockoptErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockoptErr
+}
+
+func (cons *SyslogUnixgram) read(conn *net.UnixConn) {
+	buffer := make([]byte, 64*1024)
+	oob := make([]byte, syscall.CmsgSpace(syscall.SizeofUcred))
+
+	for {
+		length, oobLength, _, _, err := conn.ReadMsgUnix(buffer, oob)
+		if err != nil {
+			return // ### return, socket closed ###
+		}
+
+		datagram := make([]byte, length)
+		copy(datagram, buffer[:length])
+
+		cons.handleMessage(datagram, parsePeerCredentials(oob[:oobLength]))
+	}
+}
+
+// peerCredentials holds the SCM_CREDENTIALS ancillary data of a datagram,
+// i.e. who sent it according to the kernel.
+type peerCredentials struct {
+	pid int32
+	uid uint32
+	gid uint32
+}
+
+func parsePeerCredentials(oob []byte) *peerCredentials {
+	if len(oob) == 0 {
+		return nil
+	}
+
+	controlMessages, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+
+	for _, cmsg := range controlMessages {
+		ucred, err := syscall.ParseUnixCredentials(&cmsg)
+		if err != nil {
+			continue
+		}
+		return &peerCredentials{pid: ucred.Pid, uid: ucred.Uid, gid: ucred.Gid}
+	}
+
+	return nil
+}
+
+// handleMessage parses a single raw syslog datagram, attaches the sender's
+// credentials (if captured) and enqueues it.
+func (cons *SyslogUnixgram) handleMessage(raw []byte, peer *peerCredentials) {
+	msg, err := cons.parser.Parse(raw)
+	if err != nil {
+		Log.Error.Print("SyslogUnixgram: ", err)
+		return
+	}
+
+	if !passesSyslogFilters(cons.severityFilter, cons.facilityFilter, msg) {
+		return // ### return, filtered out by severity/facility policy ###
+	}
+
+	sequence := *cons.sequence
+	*cons.sequence++
+
+	if !cons.setMetadata {
+		cons.Enqueue([]byte(msg.Content), sequence)
+		return
+	}
+
+	meta := buildSyslogMetadata(cons.metadataFields, msg)
+	if peer != nil {
+		meta.SetValue("peer_pid", []byte(fmt.Sprintf("%d", peer.pid)))
+		meta.SetValue("peer_uid", []byte(fmt.Sprintf("%d", peer.uid)))
+		meta.SetValue("peer_gid", []byte(fmt.Sprintf("%d", peer.gid)))
+	}
+
+	cons.EnqueueWithMetadata([]byte(msg.Content), meta, sequence)
+}
@@ -15,13 +15,28 @@
 package consumer
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/trivago/gollum/core"
 	"github.com/trivago/gollum/core/log"
 	"github.com/trivago/gollum/shared"
-	"gopkg.in/mcuadros/go-syslog.v2"
-	"gopkg.in/mcuadros/go-syslog.v2/format"
+	"github.com/trivago/gollum/shared/syslog"
+	"io"
+	"net"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// syslogFormat selects which RFC a Syslogd consumer expects to receive.
+type syslogFormat int
+
+const (
+	syslogFormatRFC3164 syslogFormat = iota
+	syslogFormatRFC5424
+	syslogFormatRFC6587
 )
 
 // Syslogd consumer plugin
@@ -45,13 +60,67 @@ import (
 // Three standards are currently supported, by default this is set to "RFC6587".
 //  * RFC3164 (https://tools.ietf.org/html/rfc3164) udp only.
 //  * RFC5424 (https://tools.ietf.org/html/rfc5424) udp only.
-//  * RFC6587 (https://tools.ietf.org/html/rfc6587) tcp or udp.
+//  * RFC6587 (https://tools.ietf.org/html/rfc6587) tcp or udp. Frames are
+//    either octet-counted ("LEN MSG") or newline separated.
+//
+// UseCurrentYear applies the current year to RFC3164 timestamps, which do
+// not carry a year of their own. By default this is set to true.
+//
+// StrictHostname rejects messages whose hostname contains characters outside
+// of [A-Za-z0-9._-] and that do not parse as an IP address. By default this
+// is set to false.
+//
+// SetMetadata defines whether the fields parsed out of the syslog message
+// (facility, severity, priority, hostname, appname, procid, msgid, timestamp
+// and, for RFC5424, structured data) are attached to the outgoing message as
+// metadata. By default this is set to false so the consumer behaves exactly
+// as before. Downstream formatters and filters can read these fields to
+// route messages without having to re-parse the raw content.
+//
+// MetadataFields allows renaming the metadata keys written above, e.g.
+// `MetadataFields: {"severity": "syslog_severity"}`. Keys not listed here
+// keep their default name.
+//
+// SeverityFilter is a list of severities (0-7) that are allowed to pass.
+// Messages with a severity not in this list are dropped. By default this
+// list is empty, i.e. no message is filtered by severity.
+//
+// FacilityFilter is a list of facilities (0-23) that are allowed to pass.
+// Messages with a facility not in this list are dropped. By default this
+// list is empty, i.e. no message is filtered by facility.
 type Syslogd struct {
 	core.ConsumerBase
-	format   format.Format // RFC3164, RFC5424 or RFC6587?
-	protocol string
-	address  string
-	sequence *uint64
+	format         syslogFormat
+	protocol       string
+	address        string
+	sequence       *uint64
+	parser         *syslog.Parser
+	setMetadata    bool
+	metadataFields map[string]string
+	severityFilter map[int]bool
+	facilityFilter map[int]bool
+
+	socketGuard sync.Mutex
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+	unixConn    *net.UnixConn
+}
+
+// defaultMetadataFields returns the canonical metadata key for every field
+// this consumer is able to extract, before any user-defined overrides are
+// applied.
+func defaultMetadataFields() map[string]string {
+	return map[string]string{
+		"facility":        "facility",
+		"severity":        "severity",
+		"priority":        "priority",
+		"hostname":        "hostname",
+		"app_name":        "app_name",
+		"proc_id":         "proc_id",
+		"msg_id":          "msg_id",
+		"timestamp":       "timestamp",
+		"structured_data": "structured_data",
+	}
 }
 
 func init() {
@@ -77,7 +146,7 @@ func (cons *Syslogd) Configure(conf core.PluginConfig) error {
 	switch format {
 	// http://www.ietf.org/rfc/rfc3164.txt
 	case "RFC3164":
-		cons.format = syslog.RFC3164
+		cons.format = syslogFormatRFC3164
 		if cons.protocol == "tcp" {
 			Log.Warning.Print("Syslog: RFC3164 demands UDP")
 			cons.protocol = "udp"
@@ -85,7 +154,7 @@ func (cons *Syslogd) Configure(conf core.PluginConfig) error {
 
 	// https://tools.ietf.org/html/rfc5424
 	case "RFC5424":
-		cons.format = syslog.RFC5424
+		cons.format = syslogFormatRFC5424
 		if cons.protocol == "tcp" {
 			Log.Warning.Print("Syslog: RFC5424 demands UDP")
 			cons.protocol = "udp"
@@ -93,67 +162,283 @@ func (cons *Syslogd) Configure(conf core.PluginConfig) error {
 
 	// https://tools.ietf.org/html/rfc6587
 	case "RFC6587":
-		cons.format = syslog.RFC6587
+		cons.format = syslogFormatRFC6587
 
 	default:
 		err = fmt.Errorf("Syslog: Format %s is not supported", format)
 	}
 
 	cons.sequence = new(uint64)
+	cons.parser = syslog.NewParser(syslog.Options{
+		UseCurrentYear: conf.GetBool("UseCurrentYear", true),
+		StrictHostname: conf.GetBool("StrictHostname", false),
+	})
+
+	cons.setMetadata = conf.GetBool("SetMetadata", false)
+	cons.metadataFields = defaultMetadataFields()
+	for field, name := range conf.GetStringMap("MetadataFields", map[string]string{}) {
+		cons.metadataFields[field] = name
+	}
+
+	cons.severityFilter = toFilterSet(conf.GetIntArray("SeverityFilter", []int64{}))
+	cons.facilityFilter = toFilterSet(conf.GetIntArray("FacilityFilter", []int64{}))
+
 	return err
 }
 
-// Handle implements the syslog handle interface
-func (cons *Syslogd) Handle(parts format.LogParts, code int64, err error) {
-	content := ""
-	isString := false
+// toFilterSet converts a list of allowed values into a lookup set. An empty
+// list means "no filtering", i.e. everything passes.
+func toFilterSet(values []int64) map[int]bool {
+	set := make(map[int]bool, len(values))
+	for _, value := range values {
+		set[int(value)] = true
+	}
+	return set
+}
+
+// handleMessage parses a single raw syslog line and enqueues it, applying
+// the configured severity/facility filters and, if enabled, attaching the
+// parsed fields as message metadata.
+func (cons *Syslogd) handleMessage(raw []byte) {
+	msg, err := cons.parser.Parse(raw)
+	if err != nil {
+		Log.Error.Print("Syslog: ", err)
+		return
+	}
 
-	switch cons.format {
-	case syslog.RFC3164:
-		content, isString = parts["content"].(string)
-	case syslog.RFC5424, syslog.RFC6587:
-		content, isString = parts["message"].(string)
-	default:
-		Log.Error.Print("Could not determine the format to retrieve message/content")
+	if !cons.passesFilters(msg) {
+		return // ### return, filtered out by severity/facility policy ###
 	}
 
-	if !isString {
-		Log.Error.Print("Message/Content is not a string")
+	sequence := atomic.AddUint64(cons.sequence, 1) - 1
+
+	if !cons.setMetadata {
+		cons.Enqueue([]byte(msg.Content), sequence)
 		return
 	}
 
-	cons.Enqueue([]byte(content), *cons.sequence)
-	*cons.sequence++
+	cons.EnqueueWithMetadata([]byte(msg.Content), cons.buildMetadata(msg), sequence)
+}
+
+// passesFilters returns false if the message's severity or facility is
+// excluded by the configured SeverityFilter/FacilityFilter.
+func (cons *Syslogd) passesFilters(msg syslog.Message) bool {
+	return passesSyslogFilters(cons.severityFilter, cons.facilityFilter, msg)
+}
+
+// passesSyslogFilters returns false if msg's severity or facility is
+// excluded by the given filter sets. An empty set allows everything through.
+func passesSyslogFilters(severityFilter, facilityFilter map[int]bool, msg syslog.Message) bool {
+	if len(severityFilter) > 0 && !severityFilter[msg.Severity] {
+		return false
+	}
+	if len(facilityFilter) > 0 && !facilityFilter[msg.Facility] {
+		return false
+	}
+	return true
+}
+
+// buildMetadata maps the parsed syslog fields onto the configured metadata
+// keys.
+func (cons *Syslogd) buildMetadata(msg syslog.Message) core.Metadata {
+	return buildSyslogMetadata(cons.metadataFields, msg)
+}
+
+// buildSyslogMetadata maps the parsed syslog fields onto the given metadata
+// keys. It is shared by every consumer that decodes messages via
+// shared/syslog (Syslogd, SyslogUnixgram).
+func buildSyslogMetadata(fields map[string]string, msg syslog.Message) core.Metadata {
+	meta := core.Metadata{}
+
+	if msg.Hostname != "" {
+		meta.SetValue(fields["hostname"], []byte(msg.Hostname))
+	}
+	if msg.AppName != "" {
+		meta.SetValue(fields["app_name"], []byte(msg.AppName))
+	}
+	if msg.ProcID != "" {
+		meta.SetValue(fields["proc_id"], []byte(msg.ProcID))
+	}
+	if msg.MsgID != "" {
+		meta.SetValue(fields["msg_id"], []byte(msg.MsgID))
+	}
+	if !msg.Timestamp.IsZero() {
+		meta.SetValue(fields["timestamp"], []byte(msg.Timestamp.Format(time.RFC3339)))
+	}
+
+	meta.SetValue(fields["facility"], []byte(strconv.Itoa(msg.Facility)))
+	meta.SetValue(fields["severity"], []byte(strconv.Itoa(msg.Severity)))
+	meta.SetValue(fields["priority"], []byte(strconv.Itoa(msg.Priority)))
+
+	for id, sdFields := range msg.StructuredData {
+		for key, value := range sdFields {
+			meta.SetValue(fmt.Sprintf("%s.%s.%s", fields["structured_data"], id, key), []byte(value))
+		}
+	}
+
+	return meta
 }
 
-// Consume opens a new syslog socket.
-// Messages are expected to be separated by \n.
+// Consume opens a new syslog socket and starts decoding messages using the
+// internal shared/syslog parser.
 func (cons *Syslogd) Consume(workers *sync.WaitGroup) {
-	server := syslog.NewServer()
-	server.SetFormat(cons.format)
-	server.SetHandler(cons)
+	reopen := func() {
+		switch cons.protocol {
+		case "unix":
+			cons.consumeUnix()
+		case "udp":
+			cons.consumeUDP()
+		case "tcp":
+			cons.consumeTCP(workers)
+		}
+	}
 
-	switch cons.protocol {
-	case "unix":
-		if err := server.ListenUnixgram(cons.address); err != nil {
-			Log.Error.Print("Syslog: Failed to open unix://", cons.address)
+	reopen()
+	cons.SetFuseBurnedCallback(cons.closeSockets)
+	cons.SetFuseActiveCallback(reopen)
+	cons.ControlLoop()
+}
+
+func (cons *Syslogd) closeSockets() {
+	cons.socketGuard.Lock()
+	defer cons.socketGuard.Unlock()
+
+	if cons.udpConn != nil {
+		cons.udpConn.Close()
+	}
+	if cons.tcpListener != nil {
+		cons.tcpListener.Close()
+	}
+	if cons.unixConn != nil {
+		cons.unixConn.Close()
+	}
+}
+
+func (cons *Syslogd) consumeUDP() {
+	conn, err := net.ListenPacket("udp", cons.address)
+	if err != nil {
+		Log.Error.Print("Syslog: Failed to open udp://", cons.address)
+		return
+	}
+
+	cons.socketGuard.Lock()
+	cons.udpConn = conn
+	cons.socketGuard.Unlock()
+
+	go func() {
+		buffer := make([]byte, 64*1024)
+		for {
+			length, _, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return // ### return, socket closed ###
+			}
+			packet := make([]byte, length)
+			copy(packet, buffer[:length])
+			cons.handleMessage(packet)
+		}
+	}()
+}
+
+func (cons *Syslogd) consumeUnix() {
+	addr, err := net.ResolveUnixAddr("unixgram", cons.address)
+	if err != nil {
+		Log.Error.Print("Syslog: Failed to resolve unix://", cons.address)
+		return
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		Log.Error.Print("Syslog: Failed to open unix://", cons.address)
+		return
+	}
+
+	cons.socketGuard.Lock()
+	cons.unixConn = conn
+	cons.socketGuard.Unlock()
+
+	go func() {
+		buffer := make([]byte, 64*1024)
+		for {
+			length, _, err := conn.ReadFromUnix(buffer)
+			if err != nil {
+				return // ### return, socket closed ###
+			}
+			packet := make([]byte, length)
+			copy(packet, buffer[:length])
+			cons.handleMessage(packet)
 		}
-	case "udp":
-		if err := server.ListenUDP(cons.address); err != nil {
-			Log.Error.Print("Syslog: Failed to open udp://", cons.address)
+	}()
+}
+
+func (cons *Syslogd) consumeTCP(workers *sync.WaitGroup) {
+	listener, err := net.Listen("tcp", cons.address)
+	if err != nil {
+		Log.Error.Print("Syslog: Failed to open tcp://", cons.address)
+		return
+	}
+
+	cons.socketGuard.Lock()
+	cons.tcpListener = listener
+	cons.socketGuard.Unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return // ### return, listener closed ###
+			}
+			workers.Add(1)
+			go cons.serveTCPConnection(conn, workers)
 		}
-	case "tcp":
-		if err := server.ListenTCP(cons.address); err != nil {
-			Log.Error.Print("Syslog: Failed to open tcp://", cons.address)
+	}()
+}
+
+// serveTCPConnection reads framed syslog messages from a single TCP
+// connection until it is closed. RFC6587 allows both octet-counted framing
+// ("LEN MSG") and newline-separated framing; this picks whichever the
+// stream uses on a per-frame basis.
+func (cons *Syslogd) serveTCPConnection(conn net.Conn, workers *sync.WaitGroup) {
+	defer workers.Done()
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		frame, err := readSyslogFrame(reader)
+		if err != nil {
+			if err != io.EOF {
+				Log.Error.Print("Syslog: ", err)
+			}
+			return // ### return, connection closed or framing error ###
 		}
+		cons.handleMessage(frame)
 	}
+}
 
-	server.Boot()
-	defer server.Kill()
+// readSyslogFrame reads a single RFC6587 frame from reader, either
+// octet-counted ("LEN MSG") or newline-terminated.
+func readSyslogFrame(reader *bufio.Reader) ([]byte, error) {
+	lengthPrefix, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
 
-	cons.SetFuseBurnedCallback(func() { server.Kill() })
-	cons.SetFuseActiveCallback(func() { server.Boot() })
-	cons.ControlLoop()
+	if lengthPrefix[0] < '0' || lengthPrefix[0] > '9' {
+		line, err := reader.ReadBytes('\n')
+		return []byte(strings.TrimRight(string(line), "\r\n")), err
+	}
 
-	server.Wait()
+	lengthStr, err := reader.ReadString(' ')
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(lengthStr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid octet count %q", lengthStr)
+	}
+
+	message := make([]byte, length)
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return nil, err
+	}
+	return message, nil
 }
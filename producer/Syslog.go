@@ -0,0 +1,274 @@
+// Copyright 2015-2016 trivago GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/log"
+	"github.com/trivago/gollum/shared"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// syslogFormat selects how a message body is rendered before it is sent.
+type syslogFormat int
+
+const (
+	syslogFormatRFC3164 syslogFormat = iota
+	syslogFormatRFC5424
+	syslogFormatRFC5424Micro
+)
+
+// syslogFramer selects how a rendered message is delimited on the wire.
+type syslogFramer int
+
+const (
+	syslogFramerLF syslogFramer = iota
+	syslogFramerOctetCounted
+)
+
+// Syslog producer plugin
+// This producer forwards messages to a remote (or local) syslogd over
+// tcp, udp or a unix socket, acting as a syslog relay counterpart to
+// consumer.Syslogd.
+// Configuration example
+//
+//  - "producer.Syslog":
+//    Address: "tcp://localhost:514"
+//    Format: "RFC5424"
+//    Framer: "OctetCounted"
+//    Tag: "gollum"
+//
+// Address defines the protocol, host and port or socket to connect to.
+// By default this is set to "udp://localhost:514".
+//
+// Format defines how the message body is rendered before it is sent. By
+// default this is set to "RFC5424".
+//  * RFC3164 (https://tools.ietf.org/html/rfc3164)
+//  * RFC5424 (https://tools.ietf.org/html/rfc5424)
+//  * rfc5424micro is RFC5424 with the MSGID field also set to Tag (APP-NAME
+//    carries Tag in both variants) so rsyslog's %syslogtag% template keeps
+//    working.
+//
+// Framer defines how messages are delimited on the wire. By default this is
+// set to "LF".
+//  * LF appends a single "\n" after every message.
+//  * OctetCounted prefixes every message with its length as defined by
+//    RFC5425. This requires a stream based transport, i.e. tcp or unix.
+//
+// Facility sets the syslog facility (0-23) to tag every message with. By
+// default this is set to 1 (user-level messages).
+//
+// Severity sets the syslog severity (0-7) to tag every message with. By
+// default this is set to 6 (informational).
+//
+// Tag sets the APP-NAME/TAG field sent with every message. By default this
+// is set to "gollum".
+//
+// Hostname sets the HOSTNAME field sent with every message. By default this
+// is set to the local machine's hostname.
+//
+// TLS enables TLS for the tcp transport. By default this is set to false.
+type Syslog struct {
+	core.ProducerBase
+	protocol  string
+	address   string
+	format    syslogFormat
+	framer    syslogFramer
+	facility  int
+	severity  int
+	tag       string
+	hostname  string
+	useTLS    bool
+	tlsConfig *tls.Config
+
+	connGuard sync.Mutex
+	conn      net.Conn
+}
+
+func init() {
+	shared.TypeRegistry.Register(Syslog{})
+}
+
+// defaultHostname returns the local machine's hostname, falling back to
+// "localhost" if it cannot be determined.
+func defaultHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	return hostname
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *Syslog) Configure(conf core.PluginConfig) error {
+	err := prod.ProducerBase.Configure(conf)
+	if err != nil {
+		return err
+	}
+
+	prod.address, prod.protocol = shared.ParseAddress(conf.GetString("Address", "udp://localhost:514"))
+	switch prod.protocol {
+	case "udp", "tcp", "unix":
+	default:
+		return fmt.Errorf("Syslog: unknown protocol type %s", prod.protocol) // ### return, unknown protocol ###
+	}
+
+	switch conf.GetString("Format", "RFC5424") {
+	case "RFC3164":
+		prod.format = syslogFormatRFC3164
+	case "RFC5424":
+		prod.format = syslogFormatRFC5424
+	case "rfc5424micro":
+		prod.format = syslogFormatRFC5424Micro
+	default:
+		return fmt.Errorf("Syslog: Format %s is not supported", conf.GetString("Format", "RFC5424"))
+	}
+
+	switch conf.GetString("Framer", "LF") {
+	case "LF":
+		prod.framer = syslogFramerLF
+	case "OctetCounted":
+		prod.framer = syslogFramerOctetCounted
+		if prod.protocol == "udp" {
+			Log.Warning.Print("Syslog: OctetCounted framing demands a stream transport, falling back to LF")
+			prod.framer = syslogFramerLF
+		}
+	default:
+		return fmt.Errorf("Syslog: Framer %s is not supported", conf.GetString("Framer", "LF"))
+	}
+
+	prod.facility = conf.GetInt("Facility", 1)
+	prod.severity = conf.GetInt("Severity", 6)
+	prod.tag = conf.GetString("Tag", "gollum")
+	prod.hostname = conf.GetString("Hostname", defaultHostname())
+	prod.useTLS = conf.GetBool("TLS", false)
+	if prod.useTLS {
+		prod.tlsConfig = &tls.Config{InsecureSkipVerify: conf.GetBool("TLSInsecureSkipVerify", false)}
+	}
+
+	return nil
+}
+
+// Produce connects to the remote syslogd and starts draining messages.
+func (prod *Syslog) Produce(workers *sync.WaitGroup) {
+	prod.AddMainWorker(workers)
+	defer prod.WorkerDone()
+
+	prod.connect()
+	prod.SetFuseBurnedCallback(prod.disconnect)
+	prod.SetFuseActiveCallback(prod.connect)
+
+	prod.MessageControlLoop(prod.sendMessage)
+}
+
+func (prod *Syslog) connect() {
+	prod.connGuard.Lock()
+	defer prod.connGuard.Unlock()
+
+	var conn net.Conn
+	var err error
+
+	if prod.useTLS && prod.protocol == "tcp" {
+		conn, err = tls.Dial("tcp", prod.address, prod.tlsConfig)
+	} else {
+		conn, err = net.Dial(prod.protocol, prod.address)
+	}
+
+	if err != nil {
+		Log.Error.Print("Syslog: Failed to connect to ", prod.protocol, "://", prod.address, ": ", err)
+		return
+	}
+
+	prod.conn = conn
+}
+
+func (prod *Syslog) disconnect() {
+	prod.connGuard.Lock()
+	defer prod.connGuard.Unlock()
+
+	if prod.conn != nil {
+		prod.conn.Close()
+		prod.conn = nil
+	}
+}
+
+// sendMessage renders and frames a single message and writes it to the
+// remote syslogd, reconnecting once if the write fails.
+func (prod *Syslog) sendMessage(msg core.Message) {
+	frame := prod.frame(prod.render(msg))
+
+	if err := prod.write(frame); err != nil {
+		Log.Error.Print("Syslog: Write failed, reconnecting: ", err)
+		prod.disconnect()
+		prod.connect()
+
+		if err := prod.write(frame); err != nil {
+			Log.Error.Print("Syslog: Dropping message, still unable to write: ", err)
+		}
+	}
+}
+
+func (prod *Syslog) write(frame []byte) error {
+	prod.connGuard.Lock()
+	conn := prod.conn
+	prod.connGuard.Unlock()
+
+	if conn == nil {
+		return fmt.Errorf("no connection to %s://%s", prod.protocol, prod.address)
+	}
+
+	_, err := conn.Write(frame)
+	return err
+}
+
+// render formats msg's content according to the configured Format.
+func (prod *Syslog) render(msg core.Message) string {
+	priority := prod.facility*8 + prod.severity
+	timestamp := time.Now()
+	content := string(msg.Data)
+
+	switch prod.format {
+	case syslogFormatRFC3164:
+		return fmt.Sprintf("<%d>%s %s %s: %s",
+			priority, timestamp.Format("Jan _2 15:04:05"), prod.hostname, prod.tag, content)
+
+	case syslogFormatRFC5424Micro:
+		// Like RFC5424 below, but MSGID is filled with Tag as well as
+		// APP-NAME so rsyslog's %syslogtag% template keeps working even
+		// though gollum, not the original process, is the one writing the
+		// message.
+		return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+			priority, timestamp.Format(time.RFC3339), prod.hostname, prod.tag, os.Getpid(), prod.tag, content)
+
+	default: // syslogFormatRFC5424
+		return fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+			priority, timestamp.Format(time.RFC3339), prod.hostname, prod.tag, os.Getpid(), content)
+	}
+}
+
+// frame delimits a rendered message according to the configured Framer.
+func (prod *Syslog) frame(rendered string) []byte {
+	switch prod.framer {
+	case syslogFramerOctetCounted:
+		return []byte(fmt.Sprintf("%d %s", len(rendered), rendered))
+	default: // syslogFramerLF
+		return []byte(rendered + "\n")
+	}
+}
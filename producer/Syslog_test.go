@@ -0,0 +1,101 @@
+// Copyright 2015-2016 trivago GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"fmt"
+	"github.com/trivago/gollum/core"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSyslogRenderRFC5424(t *testing.T) {
+	prod := &Syslog{
+		format:   syslogFormatRFC5424,
+		facility: 1,
+		severity: 6,
+		tag:      "gollum",
+		hostname: "myhost",
+	}
+
+	rendered := prod.render(core.Message{Data: []byte("hello world")})
+
+	const want = "<14>1 "
+	if !strings.HasPrefix(rendered, want) {
+		t.Fatalf("render() = %q, want prefix %q", rendered, want)
+	}
+	if !strings.Contains(rendered, " myhost gollum "+fmt.Sprint(os.Getpid())+" - - hello world") {
+		t.Errorf("render() = %q, missing expected HOST APP-NAME PROCID MSGID STRUCTURED-DATA MSG fields", rendered)
+	}
+}
+
+func TestSyslogRenderRFC5424Micro(t *testing.T) {
+	prod := &Syslog{
+		format:   syslogFormatRFC5424Micro,
+		facility: 1,
+		severity: 6,
+		tag:      "gollum",
+		hostname: "myhost",
+	}
+
+	rendered := prod.render(core.Message{Data: []byte("hello world")})
+
+	if !strings.Contains(rendered, " myhost gollum "+fmt.Sprint(os.Getpid())+" gollum - hello world") {
+		t.Errorf("render() = %q, want APP-NAME and MSGID both set to Tag plus a '-' STRUCTURED-DATA placeholder", rendered)
+	}
+}
+
+func TestSyslogRenderRFC3164(t *testing.T) {
+	prod := &Syslog{
+		format:   syslogFormatRFC3164,
+		facility: 1,
+		severity: 6,
+		tag:      "gollum",
+		hostname: "myhost",
+	}
+
+	rendered := prod.render(core.Message{Data: []byte("hello world")})
+
+	const want = "<14>"
+	if !strings.HasPrefix(rendered, want) {
+		t.Fatalf("render() = %q, want prefix %q", rendered, want)
+	}
+	if !strings.HasSuffix(rendered, "myhost gollum: hello world") {
+		t.Errorf("render() = %q, want suffix %q", rendered, "myhost gollum: hello world")
+	}
+}
+
+func TestSyslogFrame(t *testing.T) {
+	tests := []struct {
+		name   string
+		framer syslogFramer
+		input  string
+		want   string
+	}{
+		{"LF", syslogFramerLF, "hello", "hello\n"},
+		{"octet counted", syslogFramerOctetCounted, "hello", "5 hello"},
+		{"octet counted empty", syslogFramerOctetCounted, "", "0 "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prod := &Syslog{framer: test.framer}
+			if got := string(prod.frame(test.input)); got != test.want {
+				t.Errorf("frame(%q) = %q, want %q", test.input, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2015-2016 trivago GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-zeromq/zmq4"
+	"github.com/trivago/gollum/core"
+	"github.com/trivago/gollum/core/log"
+	"github.com/trivago/gollum/shared"
+	"io/ioutil"
+	"sync"
+)
+
+// ZMQ producer plugin
+// This producer writes messages to a ZeroMQ socket. It is the write-side
+// counterpart of consumer.ZMQ, built on the same CGo-free ZMTP
+// implementation, and gives gollum a first-class transport for fan-out
+// between gollum instances without routing through Kafka or a raw TCP
+// socket.
+// Configuration example
+//
+//  - "producer.ZMQ":
+//    Address: "tcp://remote-gollum:5880"
+//    SocketType: "Pub"
+//    Topic: "auth."
+//
+// Address defines the endpoint to connect to. By default this is set to
+// "tcp://localhost:5880".
+//
+// SocketType selects the ZeroMQ socket pattern to use. By default this is
+// set to "Pub".
+//  * Pub (paired with consumer.ZMQ's Sub)
+//  * Push (paired with consumer.ZMQ's Pull)
+//  * Dealer (paired with consumer.ZMQ's Router)
+//
+// Router is intentionally not offered here: routing a reply to the right
+// peer requires caching each Dealer's identity frame off of a receive
+// loop, which this producer (a send-only plugin) does not have. Pair
+// consumer.ZMQ's Router with this producer's Dealer instead.
+//
+// Topic prepends a topic frame to every message sent over a "Pub" socket so
+// consumer.ZMQ's SubscribeTopics can filter on it. By default this is
+// empty, i.e. no topic frame is sent.
+//
+// HighWaterMark sets the number of messages to queue in memory before the
+// socket starts blocking or dropping messages, depending on the socket
+// type. By default this is set to 1000.
+//
+// Linger sets the number of milliseconds a socket keeps trying to deliver
+// pending messages after Close is called. By default this is set to 0.
+//
+// CurveSecretKeyFile and CurvePublicKeyFile point to files holding this
+// socket's CURVE Z85 keypair. CurveServerKeyFile additionally points to
+// the remote server's public key. When unset (the default) CURVE
+// authentication is disabled.
+type ZMQ struct {
+	core.ProducerBase
+	address       string
+	socketType    string
+	topic         string
+	highWaterMark int
+	linger        int
+	curve         curveConfig
+
+	socketGuard sync.Mutex
+	socket      zmq4.Socket
+	cancel      context.CancelFunc
+}
+
+// curveConfig bundles the CURVE keypair/server key file paths. It mirrors
+// consumer.ZMQ's curveConfig; the two packages are independent plugin
+// packages and do not share private types.
+type curveConfig struct {
+	secretKeyFile string
+	publicKeyFile string
+	serverKeyFile string
+}
+
+func init() {
+	shared.TypeRegistry.Register(ZMQ{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *ZMQ) Configure(conf core.PluginConfig) error {
+	err := prod.ProducerBase.Configure(conf)
+	if err != nil {
+		return err
+	}
+
+	prod.address = conf.GetString("Address", "tcp://localhost:5880")
+	prod.socketType = conf.GetString("SocketType", "Pub")
+	prod.topic = conf.GetString("Topic", "")
+	prod.highWaterMark = conf.GetInt("HighWaterMark", 1000)
+	prod.linger = conf.GetInt("Linger", 0)
+
+	prod.curve = curveConfig{
+		secretKeyFile: conf.GetString("CurveSecretKeyFile", ""),
+		publicKeyFile: conf.GetString("CurvePublicKeyFile", ""),
+		serverKeyFile: conf.GetString("CurveServerKeyFile", ""),
+	}
+
+	switch prod.socketType {
+	case "Pub", "Push", "Dealer":
+	case "Router":
+		return fmt.Errorf("ZMQ: SocketType Router is not supported by producer.ZMQ, pair consumer.ZMQ's Router with this producer's Dealer instead") // ### return, unsupported socket type ###
+	default:
+		return fmt.Errorf("ZMQ: unknown socket type %s", prod.socketType) // ### return, unknown socket type ###
+	}
+
+	return nil
+}
+
+// Produce connects the configured ZeroMQ socket and starts draining
+// messages.
+func (prod *ZMQ) Produce(workers *sync.WaitGroup) {
+	prod.AddMainWorker(workers)
+	defer prod.WorkerDone()
+
+	prod.connect()
+	prod.SetFuseBurnedCallback(prod.disconnect)
+	prod.SetFuseActiveCallback(prod.connect)
+
+	prod.MessageControlLoop(prod.sendMessage)
+}
+
+func (prod *ZMQ) connect() {
+	ctx, cancel := context.WithCancel(context.Background())
+	options := curveOptions(prod.curve)
+
+	var socket zmq4.Socket
+	switch prod.socketType {
+	case "Pub":
+		socket = zmq4.NewPub(ctx, options...)
+	case "Push":
+		socket = zmq4.NewPush(ctx, options...)
+	case "Dealer":
+		socket = zmq4.NewDealer(ctx, options...)
+	}
+
+	applySocketTuning(socket, prod.highWaterMark, prod.linger)
+
+	if err := socket.Dial(prod.address); err != nil {
+		Log.Error.Print("ZMQ: Failed to reach ", prod.address, ": ", err)
+		cancel()
+		return
+	}
+
+	prod.socketGuard.Lock()
+	prod.socket = socket
+	prod.cancel = cancel
+	prod.socketGuard.Unlock()
+}
+
+func (prod *ZMQ) disconnect() {
+	prod.socketGuard.Lock()
+	defer prod.socketGuard.Unlock()
+
+	if prod.socket != nil {
+		prod.socket.Close()
+		prod.socket = nil
+	}
+	if prod.cancel != nil {
+		prod.cancel()
+		prod.cancel = nil
+	}
+}
+
+func (prod *ZMQ) sendMessage(msg core.Message) {
+	prod.socketGuard.Lock()
+	socket := prod.socket
+	prod.socketGuard.Unlock()
+
+	if socket == nil {
+		Log.Error.Print("ZMQ: Dropping message, no connection to ", prod.address)
+		return
+	}
+
+	frames := [][]byte{msg.Data}
+	if prod.socketType == "Pub" && prod.topic != "" {
+		frames = [][]byte{[]byte(prod.topic), msg.Data}
+	}
+
+	if err := socket.Send(zmq4.NewMsgFrom(frames...)); err != nil {
+		Log.Error.Print("ZMQ: Failed to send message: ", err)
+	}
+}
+
+// curveOptions builds the zmq4 dialer/listener options implementing CURVE
+// authentication from a set of Z85 keypair files, if configured.
+func curveOptions(curve curveConfig) []zmq4.Option {
+	if curve.secretKeyFile == "" || curve.publicKeyFile == "" {
+		return nil
+	}
+
+	secret, err := ioutil.ReadFile(curve.secretKeyFile)
+	if err != nil {
+		Log.Error.Print("ZMQ: Failed to read CurveSecretKeyFile: ", err)
+		return nil
+	}
+	public, err := ioutil.ReadFile(curve.publicKeyFile)
+	if err != nil {
+		Log.Error.Print("ZMQ: Failed to read CurvePublicKeyFile: ", err)
+		return nil
+	}
+
+	options := []zmq4.Option{zmq4.WithSecurity(zmq4.NewCurveSecurity(string(public), string(secret)))}
+
+	if curve.serverKeyFile != "" {
+		serverKey, err := ioutil.ReadFile(curve.serverKeyFile)
+		if err != nil {
+			Log.Error.Print("ZMQ: Failed to read CurveServerKeyFile: ", err)
+			return options
+		}
+		options = append(options, zmq4.WithServerPublicKey(string(serverKey)))
+	}
+
+	return options
+}
+
+// applySocketTuning sets the high-water-mark and linger socket options,
+// ignoring errors from backends that do not support tuning a given option.
+func applySocketTuning(socket zmq4.Socket, highWaterMark, lingerMillis int) {
+	socket.SetOption(zmq4.OptionHWM, highWaterMark)
+	socket.SetOption(zmq4.OptionLinger, lingerMillis)
+}
@@ -0,0 +1,356 @@
+// Copyright 2015-2016 trivago GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shared
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PluginConfig holds the raw, but already env-expanded, settings for a
+// single configured instance of a plugin class. core.PluginConfig wraps one
+// of these with typed getters (GetString, GetInt, ...) once Config.Validate
+// has passed.
+type PluginConfig struct {
+	Typename string
+	Enable   bool
+	Settings map[string]interface{}
+	File     string
+	Line     int
+}
+
+// Config is the fully parsed gollum configuration. Settings is keyed by
+// plugin class name (e.g. "consumer.Syslogd") and holds one entry per
+// configured instance, preserving the "list of single-key maps" shape used
+// throughout gollum's example configs.
+type Config struct {
+	Settings map[string][]PluginConfig
+	path     string
+}
+
+// envPattern matches "${NAME}" and "${NAME:default}".
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::([^}]*))?\}`)
+
+// expandEnv replaces every ${NAME} or ${NAME:default} reference in value
+// with the named environment variable, falling back to default (or the
+// empty string) when it is unset.
+func expandEnv(value string) string {
+	return envPattern.ReplaceAllStringFunc(value, func(match string) string {
+		groups := envPattern.FindStringSubmatch(match)
+		name, fallback := groups[1], groups[2]
+		if envValue, isSet := os.LookupEnv(name); isSet {
+			return envValue
+		}
+		return fallback
+	})
+}
+
+// ReadConfig loads path, expanding "${ENV:default}" references and resolving
+// "!include glob" entries along the way. The result is not yet validated;
+// call Config.Validate once every consumer/producer package has registered
+// its type with TypeRegistry.
+func ReadConfig(path string) (*Config, error) {
+	conf := &Config{Settings: make(map[string][]PluginConfig), path: path}
+	if err := conf.load(path); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// load parses a single YAML file and merges its plugin list into conf,
+// recursing into any "!include" entries it finds.
+func (conf *Config) load(path string) error {
+	buffer, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(buffer, &document); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	if len(document.Content) == 0 {
+		return nil // ### return, empty file ###
+	}
+
+	pluginList := document.Content[0]
+	if pluginList.Kind != yaml.SequenceNode {
+		return fmt.Errorf("%s:%d: expected a list of plugin definitions", path, pluginList.Line)
+	}
+
+	for _, pluginNode := range pluginList.Content {
+		if pluginNode.Tag == "!include" {
+			if err := conf.resolveInclude(path, pluginNode); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := conf.addPlugin(path, pluginNode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveInclude expands an "!include path/glob.yaml" entry, loading every
+// matching file relative to the file that referenced it.
+func (conf *Config) resolveInclude(path string, node *yaml.Node) error {
+	pattern := filepath.Join(filepath.Dir(path), node.Value)
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("%s:%d: invalid include pattern %q: %s", path, node.Line, node.Value, err)
+	}
+
+	for _, match := range matches {
+		if err := conf.load(match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addPlugin decodes a single "ClassName: {key: value, ...}" list entry and
+// appends it to conf.Settings.
+func (conf *Config) addPlugin(path string, pluginNode *yaml.Node) error {
+	if pluginNode.Kind != yaml.MappingNode || len(pluginNode.Content) != 2 {
+		return fmt.Errorf("%s:%d: expected a single \"ClassName: {...}\" entry", path, pluginNode.Line)
+	}
+
+	classNode, settingsNode := pluginNode.Content[0], pluginNode.Content[1]
+	plugin := PluginConfig{
+		Typename: classNode.Value,
+		Enable:   false, // matches the pre-yaml.v3 loader: a plugin without an explicit "Enable" key stays disabled
+		Settings: make(map[string]interface{}),
+		File:     path,
+		Line:     classNode.Line,
+	}
+
+	for i := 0; i+1 < len(settingsNode.Content); i += 2 {
+		keyNode, valueNode := settingsNode.Content[i], settingsNode.Content[i+1]
+
+		value, err := decodeValue(valueNode)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", path, valueNode.Line, err)
+		}
+
+		switch keyNode.Value {
+		case "Enable":
+			enable, isBool := value.(bool)
+			if !isBool {
+				return fmt.Errorf("%s:%d: Enable must be a bool", path, valueNode.Line)
+			}
+			plugin.Enable = enable
+		default:
+			plugin.Settings[keyNode.Value] = value
+		}
+	}
+
+	conf.Settings[plugin.Typename] = append(conf.Settings[plugin.Typename], plugin)
+	return nil
+}
+
+// decodeValue turns a YAML node into plain Go values (string, bool, int,
+// float64, map[string]interface{}, []interface{}), expanding "${ENV}"
+// references in every string scalar it encounters.
+func decodeValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var raw interface{}
+		if err := node.Decode(&raw); err != nil {
+			return nil, err
+		}
+		if str, isString := raw.(string); isString {
+			return expandEnv(str), nil
+		}
+		return raw, nil
+
+	case yaml.MappingNode:
+		result := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value, err := decodeValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			result[node.Content[i].Value] = value
+		}
+		return result, nil
+
+	case yaml.SequenceNode:
+		result := make([]interface{}, len(node.Content))
+		for i, item := range node.Content {
+			value, err := decodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = value
+		}
+		return result, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported YAML node kind %v", node.Kind)
+	}
+}
+
+// Validate checks every configured plugin instance against the `config:"..."`
+// struct tags declared on its type, as registered with TypeRegistry. It must
+// be called once after every consumer/producer package has run its init()
+// registration and before any plugin is instantiated, so a misconfigured
+// field is reported immediately instead of at the first message.
+//
+// Three tag rules are understood: `config:"required"` rejects a missing
+// field; `config:"enum=a|b|c"` rejects a value that isn't one of the given
+// options; and, for every tagged field regardless of the other rules, the
+// configured value is coerced to the field's Go type (e.g. the YAML string
+// "8" becomes an int for an int field) or rejected if it cannot be. A field
+// without a `config` tag is not validated.
+func (conf *Config) Validate() error {
+	for typename, instances := range conf.Settings {
+		pluginType, err := TypeRegistry.GetTypeOf(typename)
+		if err != nil {
+			return fmt.Errorf("%s: unknown plugin type %q", conf.path, typename)
+		}
+
+		for _, plugin := range instances {
+			if err := validatePlugin(pluginType, plugin); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validatePlugin(pluginType reflect.Type, plugin PluginConfig) error {
+	for i := 0; i < pluginType.NumField(); i++ {
+		field := pluginType.Field(i)
+		tag := field.Tag.Get("config")
+		if tag == "" {
+			continue
+		}
+
+		key := field.Name
+		if name := field.Tag.Get("key"); name != "" {
+			key = name
+		}
+		value, isSet := plugin.Settings[key]
+
+		if isSet {
+			coerced, err := coerceValue(field.Type, value)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s.%s: %s", plugin.File, plugin.Line, plugin.Typename, key, err)
+			}
+			plugin.Settings[key] = coerced
+			value = coerced
+		}
+
+		for _, rule := range strings.Split(tag, ",") {
+			switch {
+			case rule == "required":
+				if !isSet {
+					return fmt.Errorf("%s:%d: %s.%s is required but missing", plugin.File, plugin.Line, plugin.Typename, key)
+				}
+
+			case strings.HasPrefix(rule, "enum="):
+				if !isSet {
+					continue
+				}
+				allowed := strings.Split(strings.TrimPrefix(rule, "enum="), "|")
+				if !containsString(allowed, fmt.Sprintf("%v", value)) {
+					return fmt.Errorf("%s:%d: %s.%s must be one of %v, got %v", plugin.File, plugin.Line, plugin.Typename, key, allowed, value)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// coerceValue converts a raw YAML scalar (string, bool, int, float64, or a
+// nested map/slice of those) to fieldType, the Go type of the struct field
+// it is destined for. It returns an error if the value cannot be
+// represented as fieldType.
+func coerceValue(fieldType reflect.Type, value interface{}) (interface{}, error) {
+	if valueType := reflect.TypeOf(value); valueType != nil && valueType.AssignableTo(fieldType) {
+		return value, nil
+	}
+
+	switch fieldType.Kind() {
+	case reflect.String:
+		if str, isString := value.(string); isString {
+			return str, nil
+		}
+
+	case reflect.Bool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch v := value.(type) {
+		case int:
+			return reflect.ValueOf(v).Convert(fieldType).Interface(), nil
+		case int64:
+			return reflect.ValueOf(v).Convert(fieldType).Interface(), nil
+		case float64:
+			return reflect.ValueOf(int64(v)).Convert(fieldType).Interface(), nil
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return reflect.ValueOf(n).Convert(fieldType).Interface(), nil
+			}
+		}
+
+	case reflect.Float32, reflect.Float64:
+		switch v := value.(type) {
+		case float64:
+			return reflect.ValueOf(v).Convert(fieldType).Interface(), nil
+		case int:
+			return reflect.ValueOf(float64(v)).Convert(fieldType).Interface(), nil
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return reflect.ValueOf(f).Convert(fieldType).Interface(), nil
+			}
+		}
+
+	case reflect.Slice:
+		if _, isSlice := value.([]interface{}); isSlice {
+			return value, nil
+		}
+
+	default:
+		return value, nil // no coercion rule for this kind, leave it as-is
+	}
+
+	return nil, fmt.Errorf("expected %s, got %T(%v)", fieldType.Kind(), value, value)
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
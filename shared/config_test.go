@@ -0,0 +1,192 @@
+// Copyright 2015-2016 trivago GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shared
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTempConfig(t *testing.T, contents string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write temp config: %s", err)
+	}
+	return path
+}
+
+func TestAddPluginEnableDefault(t *testing.T) {
+	path := writeTempConfig(t, `
+- "consumer.Console":
+    Foo: "bar"
+`)
+
+	conf, err := ReadConfig(path)
+	if err != nil {
+		t.Fatalf("ReadConfig() returned an error: %s", err)
+	}
+
+	plugin := conf.Settings["consumer.Console"][0]
+	if plugin.Enable {
+		t.Errorf("Enable = true, want false for a plugin without an explicit Enable key")
+	}
+}
+
+func TestAddPluginEnableExplicit(t *testing.T) {
+	path := writeTempConfig(t, `
+- "consumer.Console":
+    Enable: true
+    Foo: "bar"
+`)
+
+	conf, err := ReadConfig(path)
+	if err != nil {
+		t.Fatalf("ReadConfig() returned an error: %s", err)
+	}
+
+	plugin := conf.Settings["consumer.Console"][0]
+	if !plugin.Enable {
+		t.Errorf("Enable = false, want true when explicitly set in YAML")
+	}
+}
+
+func TestResolveInclude(t *testing.T) {
+	dir := t.TempDir()
+
+	includedPath := filepath.Join(dir, "included.yaml")
+	if err := ioutil.WriteFile(includedPath, []byte(`
+- "consumer.Console":
+    Foo: "bar"
+`), 0644); err != nil {
+		t.Fatalf("failed to write included config: %s", err)
+	}
+
+	mainPath := filepath.Join(dir, "main.yaml")
+	if err := ioutil.WriteFile(mainPath, []byte(`
+- !include "included.yaml"
+- "producer.Console":
+    Foo: "baz"
+`), 0644); err != nil {
+		t.Fatalf("failed to write main config: %s", err)
+	}
+
+	conf, err := ReadConfig(mainPath)
+	if err != nil {
+		t.Fatalf("ReadConfig() returned an error: %s", err)
+	}
+
+	if _, ok := conf.Settings["consumer.Console"]; !ok {
+		t.Errorf("Settings missing %q, included.yaml was not merged in", "consumer.Console")
+	}
+	if _, ok := conf.Settings["producer.Console"]; !ok {
+		t.Errorf("Settings missing %q, main.yaml's own entries were lost", "producer.Console")
+	}
+}
+
+func TestResolveIncludeGlob(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"a.yaml", "b.yaml"} {
+		contents := `
+- "consumer.Console":
+    Foo: "` + name + `"
+`
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("failed to write %s: %s", name, err)
+		}
+	}
+
+	mainPath := filepath.Join(dir, "main.yaml")
+	if err := ioutil.WriteFile(mainPath, []byte(`
+- !include "[ab].yaml"
+`), 0644); err != nil {
+		t.Fatalf("failed to write main config: %s", err)
+	}
+
+	conf, err := ReadConfig(mainPath)
+	if err != nil {
+		t.Fatalf("ReadConfig() returned an error: %s", err)
+	}
+
+	if instances := conf.Settings["consumer.Console"]; len(instances) != 2 {
+		t.Errorf("got %d consumer.Console instances, want 2 (one per glob match)", len(instances))
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("GOLLUM_TEST_VAR", "value")
+	defer os.Unsetenv("GOLLUM_TEST_VAR")
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"set var", "${GOLLUM_TEST_VAR}", "value"},
+		{"unset var with default", "${GOLLUM_TEST_UNSET:fallback}", "fallback"},
+		{"unset var without default", "${GOLLUM_TEST_UNSET}", ""},
+		{"no reference", "plain", "plain"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := expandEnv(test.input); got != test.want {
+				t.Errorf("expandEnv(%q) = %q, want %q", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCoerceValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		fieldType reflect.Type
+		value     interface{}
+		want      interface{}
+		wantErr   bool
+	}{
+		{"string passthrough", reflect.TypeOf(""), "hello", "hello", false},
+		{"string to bool", reflect.TypeOf(true), "true", true, false},
+		{"bool passthrough", reflect.TypeOf(true), false, false, false},
+		{"string to int64", reflect.TypeOf(int64(0)), "42", int64(42), false},
+		{"float64 to int64", reflect.TypeOf(int64(0)), float64(42), int64(42), false},
+		{"string to float64", reflect.TypeOf(float64(0)), "3.5", 3.5, false},
+		{"invalid int", reflect.TypeOf(int64(0)), "not-a-number", nil, true},
+		{"invalid bool", reflect.TypeOf(true), "not-a-bool", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := coerceValue(test.fieldType, test.value)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("coerceValue() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("coerceValue() returned an error: %s", err)
+			}
+			if got != test.want {
+				t.Errorf("coerceValue() = %v (%T), want %v (%T)", got, got, test.want, test.want)
+			}
+		})
+	}
+}
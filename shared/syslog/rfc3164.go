@@ -0,0 +1,141 @@
+// Copyright 2015-2016 trivago GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// parseRFC3164 decodes the TIMESTAMP HOSTNAME TAG[PID]: CONTENT part of an
+// RFC3164 message. The cursor is expected to be positioned right after the
+// PRI value.
+func (p *Parser) parseRFC3164(c *cursor, msg Message) (Message, error) {
+	timestamp, err := p.parseRFC3164Timestamp(c)
+	if err != nil {
+		return Message{}, err
+	}
+	msg.Timestamp = timestamp
+
+	c.skipSpaces()
+	hostname := c.readUntil(' ')
+	if p.options.StrictHostname && !isValidHostname(hostname) {
+		return Message{}, fmt.Errorf("syslog: invalid hostname %q", hostname)
+	}
+	msg.Hostname = hostname
+	c.skipSpaces()
+
+	msg.AppName, msg.ProcID = parseTag(c)
+	msg.Content = strings.TrimPrefix(string(c.buffer[c.pos:]), " ")
+
+	return msg, nil
+}
+
+// parseRFC3164Timestamp tries the fixed-width layouts in timestampLayouts in
+// order and RFC3339 last, applying UseCurrentYear when the matched layout
+// has no year of its own.
+//
+// Each fixed-width layout is matched against a window sized to that exact
+// layout (e.g. 20 bytes for "Jan _2 15:04:05 2006", 15 for "Jan _2
+// 15:04:05") rather than a single hardcoded width, since timestampLayouts
+// lists the year-bearing layout before the year-less one: trying the
+// shorter window first would let it match the first 15 bytes of a
+// year-bearing stamp and leave the trailing " 2006" to be misparsed as the
+// hostname.
+func (p *Parser) parseRFC3164Timestamp(c *cursor) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if layout == time.RFC3339 {
+			continue // tried separately below, RFC3339 is variable width
+		}
+
+		length := len(layout)
+		if c.pos+length > c.len {
+			continue // ### continue, message too short for this layout ###
+		}
+
+		candidate := string(c.buffer[c.pos : c.pos+length])
+		if t, err := time.Parse(layout, candidate); err == nil {
+			c.pos += length
+			return p.applyCurrentYear(t), nil
+		}
+	}
+
+	// Fall back to RFC3339 (variable width, terminated by the next space).
+	rest := c.readUntil(' ')
+	if t, err := time.Parse(time.RFC3339, rest); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("syslog: unable to parse timestamp near %q", rest)
+}
+
+func (p *Parser) applyCurrentYear(t time.Time) time.Time {
+	if !p.options.UseCurrentYear || t.Year() > 0 {
+		return t
+	}
+	return time.Date(time.Now().Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// parseTag reads "TAG[PID]:" or "TAG:" and leaves the cursor positioned
+// right after the separating ':'; a following space is not consumed.
+func parseTag(c *cursor) (tag, procID string) {
+	start := c.pos
+	for !c.eof() {
+		switch c.buffer[c.pos] {
+		case '[':
+			tag = string(c.buffer[start:c.pos])
+			c.pos++
+			pidStart := c.pos
+			for !c.eof() && c.buffer[c.pos] != ']' {
+				c.pos++
+			}
+			procID = string(c.buffer[pidStart:c.pos])
+			if !c.eof() {
+				c.pos++ // skip ']'
+			}
+			if !c.eof() && c.buffer[c.pos] == ':' {
+				c.pos++
+			}
+			return tag, procID
+		case ':':
+			tag = string(c.buffer[start:c.pos])
+			c.pos++
+			return tag, ""
+		}
+		c.pos++
+	}
+	// No tag separator found, treat nothing as consumed.
+	c.pos = start
+	return "", ""
+}
+
+func isValidHostname(hostname string) bool {
+	if hostname == "" {
+		return false
+	}
+	if net.ParseIP(hostname) != nil {
+		return true
+	}
+	for _, r := range hostname {
+		isAllowed := (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') ||
+			(r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-'
+		if !isAllowed {
+			return false
+		}
+	}
+	return true
+}
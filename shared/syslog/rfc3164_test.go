@@ -0,0 +1,68 @@
+// Copyright 2015-2016 trivago GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syslog
+
+import "testing"
+
+func TestParseRFC3164Timestamp(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		hostname string
+		appName  string
+		procID   string
+		content  string
+	}{
+		{
+			name:     "no year",
+			message:  "<34>Jan  2 15:04:05 myhost myapp[123]: test message",
+			hostname: "myhost",
+			appName:  "myapp",
+			procID:   "123",
+			content:  "test message",
+		},
+		{
+			name:     "with year",
+			message:  "<34>Jan  2 15:04:05 2026 myhost myapp[123]: test message",
+			hostname: "myhost",
+			appName:  "myapp",
+			procID:   "123",
+			content:  "test message",
+		},
+	}
+
+	parser := NewParser(Options{})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg, err := parser.Parse([]byte(test.message))
+			if err != nil {
+				t.Fatalf("Parse() returned an error: %s", err)
+			}
+			if msg.Hostname != test.hostname {
+				t.Errorf("Hostname = %q, want %q", msg.Hostname, test.hostname)
+			}
+			if msg.AppName != test.appName {
+				t.Errorf("AppName = %q, want %q", msg.AppName, test.appName)
+			}
+			if msg.ProcID != test.procID {
+				t.Errorf("ProcID = %q, want %q", msg.ProcID, test.procID)
+			}
+			if msg.Content != test.content {
+				t.Errorf("Content = %q, want %q", msg.Content, test.content)
+			}
+		})
+	}
+}
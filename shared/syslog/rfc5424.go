@@ -0,0 +1,146 @@
+// Copyright 2015-2016 trivago GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syslog
+
+import (
+	"fmt"
+	"time"
+)
+
+// nilValue is the RFC5424 placeholder for an absent field.
+const nilValue = "-"
+
+// parseRFC5424 decodes the TIMESTAMP HOST APP-NAME PROCID MSGID
+// [STRUCTURED-DATA] MSG part of an RFC5424 message. The cursor is expected
+// to be positioned right after the "1 " version token.
+func (p *Parser) parseRFC5424(c *cursor, msg Message) (Message, error) {
+	timestampStr := c.readUntil(' ')
+	c.skipSpaces()
+	if timestampStr != nilValue {
+		timestamp, err := time.Parse(time.RFC3339Nano, timestampStr)
+		if err != nil {
+			return Message{}, fmt.Errorf("syslog: unable to parse timestamp %q: %s", timestampStr, err)
+		}
+		msg.Timestamp = timestamp
+	}
+
+	hostname := c.readUntil(' ')
+	c.skipSpaces()
+	if hostname != nilValue {
+		if p.options.StrictHostname && !isValidHostname(hostname) {
+			return Message{}, fmt.Errorf("syslog: invalid hostname %q", hostname)
+		}
+		msg.Hostname = hostname
+	}
+
+	if appName := c.readUntil(' '); appName != nilValue {
+		msg.AppName = appName
+	}
+	c.skipSpaces()
+
+	if procID := c.readUntil(' '); procID != nilValue {
+		msg.ProcID = procID
+	}
+	c.skipSpaces()
+
+	if msgID := c.readUntil(' '); msgID != nilValue {
+		msg.MsgID = msgID
+	}
+	c.skipSpaces()
+
+	structuredData, err := parseStructuredData(c)
+	if err != nil {
+		return Message{}, err
+	}
+	msg.StructuredData = structuredData
+
+	c.skipSpaces()
+	msg.Content = string(c.buffer[c.pos:])
+
+	return msg, nil
+}
+
+// parseStructuredData parses zero or more SD-ELEMENTs of the form
+// [id key="value" key="value" ...] into a map keyed by SD-ID. A lone "-"
+// means no structured data is present.
+func parseStructuredData(c *cursor) (map[string]map[string]string, error) {
+	if !c.eof() && c.peek() == '-' {
+		c.pos++
+		return nil, nil
+	}
+
+	data := make(map[string]map[string]string)
+	for !c.eof() && c.peek() == '[' {
+		c.pos++
+		id := c.readUntil(' ', ']')
+		fields := make(map[string]string)
+
+		for {
+			c.skipSpaces()
+			if c.eof() || c.peek() == ']' {
+				break
+			}
+			key := c.readUntil('=')
+			if c.eof() {
+				return nil, fmt.Errorf("syslog: malformed structured data, missing '=' after %q", key)
+			}
+			c.pos++ // skip '='
+
+			value, err := readQuotedValue(c)
+			if err != nil {
+				return nil, err
+			}
+			fields[key] = value
+		}
+
+		if c.eof() {
+			return nil, fmt.Errorf("syslog: unterminated structured data element %q", id)
+		}
+		c.pos++ // skip ']'
+
+		data[id] = fields
+	}
+
+	return data, nil
+}
+
+// readQuotedValue reads a double-quoted SD-PARAM value, unescaping
+// backslash-escaped '"', '\' and ']' as defined by RFC5424.
+func readQuotedValue(c *cursor) (string, error) {
+	if c.eof() || c.peek() != '"' {
+		return "", fmt.Errorf("syslog: expected '\"' to start structured data value")
+	}
+	c.pos++
+
+	var value []byte
+	for !c.eof() {
+		b := c.buffer[c.pos]
+		switch {
+		case b == '\\' && c.pos+1 < c.len &&
+			(c.buffer[c.pos+1] == '"' || c.buffer[c.pos+1] == '\\' || c.buffer[c.pos+1] == ']'):
+			c.pos++
+			value = append(value, c.buffer[c.pos])
+			c.pos++
+		case b == '"':
+			c.pos++
+			return string(value), nil
+		default:
+			value = append(value, b)
+			c.pos++
+		}
+	}
+
+	return "", fmt.Errorf("syslog: unterminated structured data value")
+}
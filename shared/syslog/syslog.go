@@ -0,0 +1,192 @@
+// Copyright 2015-2016 trivago GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package syslog implements a dependency-free RFC3164 and RFC5424 syslog
+// message parser. It is used by consumer.Syslogd (and may be reused by other
+// producers or file-tailing consumers) so gollum does not have to vendor
+// gopkg.in/mcuadros/go-syslog.v2 just to decode a handful of header fields.
+package syslog
+
+import (
+	"fmt"
+	"time"
+)
+
+// Message holds all fields a Parser is able to extract from a single
+// RFC3164 or RFC5424 formatted syslog line.
+type Message struct {
+	Facility       int
+	Severity       int
+	Priority       int
+	Version        int
+	Timestamp      time.Time
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData map[string]map[string]string
+	Content        string
+}
+
+// Options controls the behavior of a Parser.
+type Options struct {
+	// UseCurrentYear applies time.Now().Year() to timestamps that do not
+	// carry a year of their own (RFC3164 only). Defaults to false, i.e. the
+	// zero year is kept as returned by time.Parse.
+	UseCurrentYear bool
+
+	// StrictHostname rejects hostnames that contain characters outside of
+	// [A-Za-z0-9._-] and that do not parse as a valid IP address. Defaults
+	// to false.
+	StrictHostname bool
+}
+
+// timestampLayouts are tried for RFC3164 timestamps, the fixed-width layouts
+// in order and RFC3339 after them. RFC5424
+// timestamps are always RFC3339 (with optional fractional seconds) and are
+// parsed separately.
+var timestampLayouts = []string{
+	time.RFC3339,
+	"Jan _2 15:04:05 2006",
+	"Jan _2 15:04:05",
+}
+
+// Parser parses RFC3164 and RFC5424 syslog messages.
+type Parser struct {
+	options Options
+}
+
+// NewParser creates a Parser configured with the given options.
+func NewParser(options Options) *Parser {
+	return &Parser{options: options}
+}
+
+// cursor walks a byte buffer keeping track of its current read position.
+// It is shared by the RFC3164 and RFC5424 parsing state machines.
+type cursor struct {
+	buffer []byte
+	pos    int
+	len    int
+}
+
+func newCursor(buffer []byte) *cursor {
+	return &cursor{buffer: buffer, pos: 0, len: len(buffer)}
+}
+
+func (c *cursor) eof() bool {
+	return c.pos >= c.len
+}
+
+func (c *cursor) peek() byte {
+	return c.buffer[c.pos]
+}
+
+func (c *cursor) skipSpaces() {
+	for !c.eof() && c.buffer[c.pos] == ' ' {
+		c.pos++
+	}
+}
+
+// readUntil consumes bytes up to (but not including) the first occurrence
+// of any byte in stopSet, or the end of the buffer if none is found.
+func (c *cursor) readUntil(stopSet ...byte) string {
+	start := c.pos
+	for !c.eof() {
+		b := c.buffer[c.pos]
+		for _, stop := range stopSet {
+			if b == stop {
+				return string(c.buffer[start:c.pos])
+			}
+		}
+		c.pos++
+	}
+	return string(c.buffer[start:c.pos])
+}
+
+// readN consumes and returns the next n bytes, or everything left if the
+// buffer is shorter than n.
+func (c *cursor) readN(n int) string {
+	end := c.pos + n
+	if end > c.len {
+		end = c.len
+	}
+	value := string(c.buffer[c.pos:end])
+	c.pos = end
+	return value
+}
+
+// parsePRI reads the leading "<PRI>" token (PRI bounded to 1-3 digits) and
+// returns the decoded facility/severity/priority plus the cursor positioned
+// right after the closing '>'.
+func parsePRI(c *cursor) (facility, severity, priority int, err error) {
+	if c.eof() || c.peek() != '<' {
+		return 0, 0, 0, fmt.Errorf("syslog: missing '<' at start of message")
+	}
+	c.pos++
+
+	start := c.pos
+	for !c.eof() && c.buffer[c.pos] != '>' {
+		if !isDigit(c.buffer[c.pos]) {
+			return 0, 0, 0, fmt.Errorf("syslog: non-numeric PRI value")
+		}
+		c.pos++
+		if c.pos-start > 3 {
+			return 0, 0, 0, fmt.Errorf("syslog: PRI value too long")
+		}
+	}
+	if c.eof() {
+		return 0, 0, 0, fmt.Errorf("syslog: unterminated PRI value")
+	}
+	if c.pos == start {
+		return 0, 0, 0, fmt.Errorf("syslog: empty PRI value")
+	}
+
+	priStr := string(c.buffer[start:c.pos])
+	c.pos++ // skip '>'
+
+	priority = 0
+	for _, digit := range priStr {
+		priority = priority*10 + int(digit-'0')
+	}
+	if priority > 191 {
+		return 0, 0, 0, fmt.Errorf("syslog: PRI value %d out of range", priority)
+	}
+
+	return priority / 8, priority % 8, priority, nil
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// Parse decodes a single syslog message. RFC5424 messages are recognized by
+// the version token ("1 ") directly following the PRI; anything else is
+// treated as RFC3164.
+func (p *Parser) Parse(data []byte) (Message, error) {
+	c := newCursor(data)
+	facility, severity, priority, err := parsePRI(c)
+	if err != nil {
+		return Message{}, err
+	}
+
+	msg := Message{Facility: facility, Severity: severity, Priority: priority}
+
+	if !c.eof() && c.peek() == '1' && c.pos+1 < c.len && c.buffer[c.pos+1] == ' ' {
+		c.pos += 2
+		msg.Version = 1
+		return p.parseRFC5424(c, msg)
+	}
+
+	return p.parseRFC3164(c, msg)
+}
@@ -0,0 +1,165 @@
+// Copyright 2015-2016 trivago GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syslog
+
+import "testing"
+
+func TestParsePRI(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		wantErr  bool
+		facility int
+		severity int
+		priority int
+	}{
+		{"min value", "<0>Jan  2 15:04:05 myhost myapp: msg", false, 0, 0, 0},
+		{"max value", "<191>Jan  2 15:04:05 myhost myapp: msg", false, 23, 7, 191},
+		{"out of range", "<192>Jan  2 15:04:05 myhost myapp: msg", true, 0, 0, 0},
+		{"too many digits", "<1911>Jan  2 15:04:05 myhost myapp: msg", true, 0, 0, 0},
+		{"non numeric", "<1a>Jan  2 15:04:05 myhost myapp: msg", true, 0, 0, 0},
+		{"missing closing bracket", "<12 Jan  2 15:04:05 myhost myapp: msg", true, 0, 0, 0},
+		{"missing leading bracket", "12>Jan  2 15:04:05 myhost myapp: msg", true, 0, 0, 0},
+	}
+
+	parser := NewParser(Options{})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg, err := parser.Parse([]byte(test.message))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Parse() = %+v, want an error", msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() returned an error: %s", err)
+			}
+			if msg.Facility != test.facility || msg.Severity != test.severity || msg.Priority != test.priority {
+				t.Errorf("got Facility=%d Severity=%d Priority=%d, want Facility=%d Severity=%d Priority=%d",
+					msg.Facility, msg.Severity, msg.Priority, test.facility, test.severity, test.priority)
+			}
+		})
+	}
+}
+
+func TestParseRFC5424StructuredData(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		wantErr bool
+		data    map[string]map[string]string
+		content string
+	}{
+		{
+			name:    "no structured data",
+			message: `<34>1 2026-07-25T15:04:05Z myhost myapp 123 - - msg body`,
+			data:    nil,
+			content: "msg body",
+		},
+		{
+			name:    "single element",
+			message: `<34>1 2026-07-25T15:04:05Z myhost myapp 123 - [exampleSDID@32473 iut="3" eventSource="App"] msg body`,
+			data: map[string]map[string]string{
+				"exampleSDID@32473": {"iut": "3", "eventSource": "App"},
+			},
+			content: "msg body",
+		},
+		{
+			name:    "escaped quote and backslash",
+			message: `<34>1 2026-07-25T15:04:05Z myhost myapp 123 - [sd@1 msg="say \"hi\" then \\ done"] content`,
+			data: map[string]map[string]string{
+				"sd@1": {"msg": `say "hi" then \ done`},
+			},
+			content: "content",
+		},
+		{
+			name:    "multiple elements",
+			message: `<34>1 2026-07-25T15:04:05Z myhost myapp 123 - [a@1 k="v"][b@1 k2="v2"] content`,
+			data: map[string]map[string]string{
+				"a@1": {"k": "v"},
+				"b@1": {"k2": "v2"},
+			},
+			content: "content",
+		},
+		{
+			name:    "malformed, missing equals",
+			message: `<34>1 2026-07-25T15:04:05Z myhost myapp 123 - [a@1 k"v"] content`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed, unterminated element",
+			message: `<34>1 2026-07-25T15:04:05Z myhost myapp 123 - [a@1 k="v" content`,
+			wantErr: true,
+		},
+	}
+
+	parser := NewParser(Options{})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg, err := parser.Parse([]byte(test.message))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Parse() = %+v, want an error", msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() returned an error: %s", err)
+			}
+			if len(msg.StructuredData) != len(test.data) {
+				t.Fatalf("StructuredData = %#v, want %#v", msg.StructuredData, test.data)
+			}
+			for id, fields := range test.data {
+				for key, value := range fields {
+					if msg.StructuredData[id][key] != value {
+						t.Errorf("StructuredData[%q][%q] = %q, want %q", id, key, msg.StructuredData[id][key], value)
+					}
+				}
+			}
+			if msg.Content != test.content {
+				t.Errorf("Content = %q, want %q", msg.Content, test.content)
+			}
+		})
+	}
+}
+
+func TestStrictHostname(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		wantErr bool
+	}{
+		{"valid hostname", "<34>Jan  2 15:04:05 my-host.example.com myapp: msg", false},
+		{"valid IPv4", "<34>Jan  2 15:04:05 192.168.1.1 myapp: msg", false},
+		{"invalid character", "<34>Jan  2 15:04:05 my/host myapp: msg", true},
+	}
+
+	parser := NewParser(Options{StrictHostname: true})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parser.Parse([]byte(test.message))
+			if test.wantErr && err == nil {
+				t.Fatalf("Parse() succeeded, want an error for an invalid hostname")
+			}
+			if !test.wantErr && err != nil {
+				t.Fatalf("Parse() returned an error: %s", err)
+			}
+		})
+	}
+}